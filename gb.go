@@ -1,88 +1,330 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"mime/multipart"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
 	"os"
 	"os/signal"
 	"runtime"
 	"runtime/debug"
 	"runtime/pprof"
 	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/rivo/tview"
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/load"
+	gopsnet "github.com/shirou/gopsutil/v3/net"
+	"golang.org/x/net/http2"
+	"gopkg.in/yaml.v3"
 )
 
 type stats struct {
-	req   int64         // requests
-	err   int64         // connection errors
-	rerr  int64         // read errors
-	bytes int64         // bytes read
-	code  map[int]int64 // status code counts
-	hist  map[int]int64 // response time histogram
+	req     int64            // requests
+	err     int64            // connection errors
+	rerr    int64            // read errors
+	bytes   int64            // bytes read
+	code    map[int]int64    // status code counts
+	hist    *hdrHistogram    // response time histogram, in microseconds
+	proto   map[string]int64 // negotiated protocol per response, e.g. "HTTP/2.0"
+	reused  int64            // requests sent over a reused connection/stream
+	newconn int64            // requests that dialed a new connection
+	retries int64            // -retry attempts made after a connection error
 }
 
 type livestats struct {
 	id    int
 	req   int64
 	bytes int64
+	code  map[int]int64 // status codes seen since the last tick
+	hist  *hdrHistogram // response times since the last tick, for windowed percentiles
 }
 
-func newStats() *stats {
+func newStats(maxUs int64) *stats {
 	s := stats{}
 	s.code = make(map[int]int64)
-	s.hist = make(map[int]int64)
+	s.hist = newHDRHistogram(maxUs)
+	s.proto = make(map[string]int64)
 
 	return &s
 }
 
-func bench(id int, req *http.Request, client *http.Client,
+// hdrSubBuckets (N) is the number of linear sub-buckets per power-of-two
+// bucket; N=128 gives ~0.78% relative error at any magnitude.
+const hdrSubBuckets = 128
+const hdrSubBucketsLog2 = 7 // log2(hdrSubBuckets)
+
+// hdrHistogram is a bounded logarithmic (HDR-like) histogram: values from
+// 1 microsecond up to maxUs are recorded with roughly constant relative
+// precision, so percentiles stay meaningful even at millions of samples and
+// at high latencies, unlike a flat per-millisecond bucket map.
+type hdrHistogram struct {
+	maxUs  int64
+	counts []int64
+}
+
+// hdrBucketOf returns the log-region bucket number for v, i.e.
+// floor(log2(v)) - log2(N). Only meaningful for v >= 2*hdrSubBuckets - the
+// linear region below that is handled separately by index/valueAt.
+func hdrBucketOf(v int64) int {
+	if v < 2*hdrSubBuckets {
+		return 0
+	}
+
+	n := 0
+	for t := v; t > 1; t >>= 1 {
+		n++
+	}
+
+	return n - hdrSubBucketsLog2
+}
+
+func newHDRHistogram(maxUs int64) *hdrHistogram {
+	if maxUs < 2*hdrSubBuckets {
+		maxUs = 2 * hdrSubBuckets
+	}
+
+	// 2 bucket-widths for the linear region plus one per log bucket.
+	numBuckets := hdrBucketOf(maxUs) + 2
+
+	return &hdrHistogram{maxUs: maxUs, counts: make([]int64, numBuckets*hdrSubBuckets)}
+}
+
+// index maps a value (in microseconds) to its slot. Bucket 0 is linear and
+// twice as wide as the rest (slots 0..2N-1, one per microsecond) so that it
+// doesn't overlap the log region: for v < 2N the slot is v itself. For
+// v >= 2N, bucket = floor(log2(v)) - log2(N) (always >= 1) and
+// sub = (v >> bucket) - N, placed right after the linear region.
+func (h *hdrHistogram) index(v int64) int {
+	if v < 1 {
+		v = 1
+	}
+	if v > h.maxUs {
+		v = h.maxUs
+	}
+
+	var idx int
+	if v < 2*hdrSubBuckets {
+		idx = int(v)
+	} else {
+		bucket := hdrBucketOf(v)
+		sub := int(v>>uint(bucket)) - hdrSubBuckets
+		idx = 2*hdrSubBuckets + (bucket-1)*hdrSubBuckets + sub
+	}
+
+	if idx >= len(h.counts) {
+		idx = len(h.counts) - 1
+	}
+
+	return idx
+}
+
+// valueAt returns the representative microsecond value for slot idx, i.e.
+// the inverse of index.
+func (h *hdrHistogram) valueAt(idx int) int64 {
+	if idx < 2*hdrSubBuckets {
+		return int64(idx)
+	}
+
+	rel := idx - 2*hdrSubBuckets
+	bucket := rel/hdrSubBuckets + 1
+	sub := rel % hdrSubBuckets
+
+	return (int64(sub) + hdrSubBuckets) << uint(bucket)
+}
+
+func (h *hdrHistogram) record(v int64) {
+	h.counts[h.index(v)]++
+}
+
+func (h *hdrHistogram) merge(o *hdrHistogram) {
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+}
+
+// hdrSummary is the min/mean/stddev/percentile report computed by walking
+// cumulative counts once.
+type hdrSummary struct {
+	Min, Mean, StdDev, Max               float64
+	P50, P75, P90, P95, P99, P999, P9999 float64
+}
+
+func (h *hdrHistogram) summarize(n int64) hdrSummary {
+	var summary hdrSummary
+	if n == 0 {
+		return summary
+	}
+
+	want := []struct {
+		pct float64
+		dst *float64
+	}{
+		{50, &summary.P50}, {75, &summary.P75}, {90, &summary.P90}, {95, &summary.P95},
+		{99, &summary.P99}, {99.9, &summary.P999}, {99.99, &summary.P9999},
+	}
+
+	var sum, sumSq float64
+	summary.Min = -1
+	var cum int64
+	wi := 0
+
+	for idx, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+
+		v := float64(h.valueAt(idx)) / 1000 // microseconds -> milliseconds
+		if summary.Min < 0 {
+			summary.Min = v
+		}
+		summary.Max = v
+
+		sum += v * float64(c)
+		sumSq += v * v * float64(c)
+
+		cum += c
+		pct := float64(cum) * 100 / float64(n)
+		for wi < len(want) && pct >= want[wi].pct {
+			*want[wi].dst = v
+			wi++
+		}
+	}
+
+	summary.Mean = sum / float64(n)
+	variance := sumSq/float64(n) - summary.Mean*summary.Mean
+	if variance > 0 {
+		summary.StdDev = math.Sqrt(variance)
+	}
+
+	return summary
+}
+
+func writeHDRFile(path string, h *hdrHistogram) error {
+	buf := &bytes.Buffer{}
+	for idx, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+
+		fmt.Fprintf(buf, "%d\t%d\n", h.valueAt(idx), c)
+	}
+
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+func bench(id int, reqs *requestSet, client *http.Client, timeout time.Duration,
 	done <-chan struct{}, result chan<- *stats, errors chan<- error,
-	rampch <-chan struct{}, livech chan<- livestats, tickch <-chan struct{}) {
+	rampch <-chan struct{}, livech chan<- livestats, tickch <-chan struct{}, schedch <-chan time.Time,
+	retry int, retryBackoff time.Duration) {
 
-	s := newStats()
+	s := newStats(timeout.Microseconds())
 	read := 0
 	buf := make([]byte, 10*1024)
 
 	var err error
+	var req *http.Request
 	var resp *http.Response
 
-	var t1, t2 time.Time
+	var sched, t2 time.Time
 	var delta time.Duration
-	var milisec int
+
+	rr := 0
+	rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
 
 	if rampch != nil {
 		<-rampch
 	}
 
-	live := livestats{id: id}
+	live := livestats{id: id, code: make(map[int]int64), hist: newHDRHistogram(timeout.Microseconds())}
 	livets := time.Now()
 
 LOOP:
 	for {
-		if tickch != nil {
-			<-tickch
-		}
+		if schedch != nil {
+			var ok bool
+			select {
+			case sched, ok = <-schedch:
+				if !ok {
+					break LOOP
+				}
+			case <-done:
+				break LOOP
+			}
+		} else {
+			if tickch != nil {
+				<-tickch
+			}
 
-		select {
-		case <-done:
-			break LOOP
-		default:
+			select {
+			case <-done:
+				break LOOP
+			default:
+			}
+
+			sched = time.Now()
 		}
 
+		req = reqs.next(&rr, rng)
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) {
+				if info.Reused {
+					s.reused++
+				} else {
+					s.newconn++
+				}
+			},
+		}))
+
 		s.req++
 		live.req++
-		t1 = time.Now()
-		resp, err = client.Do(req)
+
+		attempt := 0
+		for {
+			resp, err = client.Do(req)
+			if err == nil || attempt >= retry || !isIdempotent(req.Method) {
+				break
+			}
+
+			attempt++
+			s.retries++
+
+			backoff := retryBackoff * time.Duration(int64(1)<<uint(attempt-1))
+			time.Sleep(time.Duration(rng.Int63n(int64(backoff) + 1)))
+
+			if req.GetBody != nil {
+				if body, berr := req.GetBody(); berr == nil {
+					req.Body = body
+				}
+			}
+		}
+
 		if err != nil {
 			errors <- fmt.Errorf("request failed: %s", err)
 			s.err++
 		} else {
 			s.code[resp.StatusCode]++
+			s.proto[resp.Proto]++
+			live.code[resp.StatusCode]++
 
 			for {
 				read, err = resp.Body.Read(buf)
@@ -102,15 +344,14 @@ LOOP:
 		}
 
 		t2 = time.Now()
-		delta = t2.Sub(t1)
-		milisec = int(delta.Nanoseconds() / 1000000)
-		s.hist[milisec]++
+		delta = t2.Sub(sched)
+		s.hist.record(delta.Microseconds())
+		live.hist.record(delta.Microseconds())
 
 		if livech != nil && t2.Sub(livets) >= 500*time.Millisecond {
 			livech <- live
 			livets = t2
-			live.req = 0
-			live.bytes = 0
+			live = livestats{id: id, code: make(map[int]int64), hist: newHDRHistogram(timeout.Microseconds())}
 		}
 	}
 
@@ -121,8 +362,210 @@ func disableRedirects(req *http.Request, via []*http.Request) error {
 	return http.ErrUseLastResponse
 }
 
-func buildClient(compress bool, redirects bool, timeout time.Duration) *http.Client {
-	transport := &http.Transport{
+// isIdempotent reports whether method is safe to retry after a connection
+// error without risking duplicate side effects.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+// h2Options tunes the per-protocol transports built for -proto h2/h2c/h3.
+type h2Options struct {
+	maxConcurrentStreams int
+	readIdleTimeout      time.Duration
+	pingTimeout          time.Duration
+}
+
+// streamLimiter wraps a RoundTripper with a semaphore so that, for
+// protocols that multiplex many streams over one connection, -h2-max-streams
+// caps how many requests a single client keeps in flight at once - the
+// closest client-side analogue to a server's SETTINGS_MAX_CONCURRENT_STREAMS.
+type streamLimiter struct {
+	rt  http.RoundTripper
+	sem chan struct{}
+}
+
+func newStreamLimiter(rt http.RoundTripper, max int) http.RoundTripper {
+	if max <= 0 {
+		return rt
+	}
+
+	return &streamLimiter{rt: rt, sem: make(chan struct{}, max)}
+}
+
+func (l *streamLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	l.sem <- struct{}{}
+	defer func() { <-l.sem }()
+
+	return l.rt.RoundTrip(req)
+}
+
+// injectOptions configures failureInjector. A zero value disables injection.
+type injectOptions struct {
+	failRate       float64
+	failCodes      []int
+	delayProb      float64
+	delay          time.Duration
+	disconnectProb float64
+}
+
+func (o injectOptions) active() bool {
+	return o.failRate > 0 || o.delayProb > 0 || o.disconnectProb > 0
+}
+
+// failureInjector wraps a transport to simulate an unstable network: on each
+// request it may synthesize a fake status code instead of dispatching, sleep
+// before dispatching, or return a connection-reset error - all without an
+// intermediate proxy.
+type failureInjector struct {
+	rt   http.RoundTripper
+	opts injectOptions
+}
+
+func newFailureInjector(rt http.RoundTripper, opts injectOptions) http.RoundTripper {
+	if !opts.active() {
+		return rt
+	}
+
+	return &failureInjector{rt: rt, opts: opts}
+}
+
+func (f *failureInjector) RoundTrip(req *http.Request) (*http.Response, error) {
+	if f.opts.disconnectProb > 0 && rand.Float64() < f.opts.disconnectProb {
+		return nil, fmt.Errorf("gb: injected disconnect: %w", syscall.ECONNRESET)
+	}
+
+	if f.opts.delay > 0 && f.opts.delayProb > 0 && rand.Float64() < f.opts.delayProb {
+		time.Sleep(f.opts.delay)
+	}
+
+	if f.opts.failRate > 0 && len(f.opts.failCodes) > 0 && rand.Float64() < f.opts.failRate {
+		return syntheticResponse(req, f.opts.failCodes[rand.Intn(len(f.opts.failCodes))]), nil
+	}
+
+	return f.rt.RoundTrip(req)
+}
+
+// syntheticResponse builds a fake response for an injected failure, as if the
+// server itself had returned code.
+func syntheticResponse(req *http.Request, code int) *http.Response {
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		StatusCode: code,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(bytes.NewReader(nil)),
+		Request:    req,
+	}
+}
+
+// parseInjectCodes parses a comma-separated list of HTTP status codes, e.g.
+// "500,502,503".
+func parseInjectCodes(s string) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var codes []int
+	for _, part := range strings.Split(s, ",") {
+		code, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid -inject-fail-codes entry %q: %s", part, err)
+		}
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// parseInjectDelay parses a "p=0.05,ms=2000" spec into a probability and a
+// delay duration.
+func parseInjectDelay(s string) (float64, time.Duration, error) {
+	var prob float64
+	var delay time.Duration
+
+	if s == "" {
+		return prob, delay, nil
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return 0, 0, fmt.Errorf("invalid -inject-delay spec %q, want 'p=0.05,ms=2000'", part)
+		}
+
+		switch key {
+		case "p":
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return 0, 0, fmt.Errorf("invalid -inject-delay probability %q: %s", value, err)
+			}
+			prob = v
+		case "ms":
+			v, err := strconv.Atoi(value)
+			if err != nil {
+				return 0, 0, fmt.Errorf("invalid -inject-delay duration %q: %s", value, err)
+			}
+			delay = time.Duration(v) * time.Millisecond
+		default:
+			return 0, 0, fmt.Errorf("invalid -inject-delay key %q, want p or ms", key)
+		}
+	}
+
+	return prob, delay, nil
+}
+
+func buildTransport(proto string, compress bool, timeout time.Duration, h2 h2Options) (http.RoundTripper, error) {
+	switch proto {
+	case "h2":
+		return newStreamLimiter(&http2.Transport{
+			TLSClientConfig:            &tls.Config{},
+			DisableCompression:         !compress,
+			ReadIdleTimeout:            h2.readIdleTimeout,
+			PingTimeout:                h2.pingTimeout,
+			StrictMaxConcurrentStreams: true,
+		}, h2.maxConcurrentStreams), nil
+
+	case "h2c":
+		return newStreamLimiter(&http2.Transport{
+			AllowHTTP:                  true,
+			DisableCompression:         !compress,
+			ReadIdleTimeout:            h2.readIdleTimeout,
+			PingTimeout:                h2.pingTimeout,
+			StrictMaxConcurrentStreams: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return (&net.Dialer{Timeout: timeout}).DialContext(ctx, network, addr)
+			},
+		}, h2.maxConcurrentStreams), nil
+
+	case "h3":
+		return newStreamLimiter(&http3.RoundTripper{
+			TLSClientConfig: &tls.Config{},
+		}, h2.maxConcurrentStreams), nil
+
+	case "h1":
+		return buildH1Transport(compress, timeout), nil
+
+	case "auto", "":
+		transport := buildH1Transport(compress, timeout)
+		if err := http2.ConfigureTransport(transport); err != nil {
+			return nil, fmt.Errorf("configuring h2: %s", err)
+		}
+		return transport, nil
+
+	default:
+		return nil, fmt.Errorf("unknown -proto %q, want h1, h2, h2c, h3 or auto", proto)
+	}
+}
+
+func buildH1Transport(compress bool, timeout time.Duration) *http.Transport {
+	return &http.Transport{
 		DisableCompression:  !compress,
 		TLSHandshakeTimeout: timeout,
 		DialContext: (&net.Dialer{
@@ -130,6 +573,13 @@ func buildClient(compress bool, redirects bool, timeout time.Duration) *http.Cli
 			DualStack: true,
 		}).DialContext,
 	}
+}
+
+func buildClient(proto string, compress bool, redirects bool, timeout time.Duration, h2 h2Options) (*http.Client, error) {
+	transport, err := buildTransport(proto, compress, timeout, h2)
+	if err != nil {
+		return nil, err
+	}
 
 	redirectHandler := disableRedirects
 	if redirects {
@@ -142,23 +592,254 @@ func buildClient(compress bool, redirects bool, timeout time.Duration) *http.Cli
 		Timeout:       timeout,
 	}
 
-	return client
+	return client, nil
+}
+
+// buildClientPool returns the clients workers send through. h1/auto keep the
+// existing one-client-per-worker model, since each is its own connection.
+// h2/h2c/h3 multiplex many streams over few connections, so -parallel
+// workers share -connections clients instead.
+func buildClientPool(f *flags, h2 h2Options, inject injectOptions) ([]*http.Client, error) {
+	n := f.parallel
+	switch f.proto {
+	case "h2", "h2c", "h3":
+		n = f.connections
+		if n <= 0 {
+			n = 1
+		}
+	}
+
+	clients := make([]*http.Client, n)
+	for i := range clients {
+		cli, err := buildClient(f.proto, f.compression, f.redirects, f.timeout, h2)
+		if err != nil {
+			return nil, err
+		}
+		cli.Transport = newFailureInjector(cli.Transport, inject)
+		clients[i] = cli
+	}
+
+	return clients, nil
+}
+
+// requestSet holds one or more request templates a worker can send. With a
+// single request it behaves like a plain benchmark; with several (loaded
+// from a -scenario file) workers cycle through them round-robin, or by
+// weight when weights are present.
+type requestSet struct {
+	reqs    []*http.Request
+	weights []int64 // cumulative weights, nil for round-robin
+}
+
+func newRequestSet(req *http.Request) *requestSet {
+	return &requestSet{reqs: []*http.Request{req}}
+}
+
+// next returns the request a worker should send, resetting its body (if
+// any) to the start so replays of the same *http.Request don't need to
+// reallocate the body buffer. rr is the caller's private round-robin
+// counter, rng its private random source for weighted picks.
+func (rs *requestSet) next(rr *int, rng *rand.Rand) *http.Request {
+	var tmpl *http.Request
+
+	switch {
+	case len(rs.reqs) == 1:
+		tmpl = rs.reqs[0]
+	case rs.weights == nil:
+		tmpl = rs.reqs[*rr%len(rs.reqs)]
+		*rr++
+	default:
+		target := rng.Int63n(rs.weights[len(rs.weights)-1])
+		i := sort.Search(len(rs.weights), func(i int) bool { return rs.weights[i] > target })
+		tmpl = rs.reqs[i]
+	}
+
+	// The template is shared by every worker, so clone it instead of
+	// mutating it in place - workers run concurrently and may be handed
+	// the same template more than once per round.
+	req := tmpl.Clone(tmpl.Context())
+	if tmpl.GetBody != nil {
+		body, err := tmpl.GetBody()
+		if err == nil {
+			req.Body = body
+		}
+	}
+
+	return req
 }
 
-func buildRequest(method, url string) (*http.Request, error) {
-	return http.NewRequest(method, url, nil)
+func applyHeaders(req *http.Request, headers []string) error {
+	for _, h := range headers {
+		i := strings.IndexByte(h, ':')
+		if i < 0 {
+			return fmt.Errorf("invalid header %q, want 'Key: Value'", h)
+		}
+
+		req.Header.Add(strings.TrimSpace(h[:i]), strings.TrimSpace(h[i+1:]))
+	}
+
+	return nil
+}
+
+// buildBody assembles the request body for the -body/-body-file/-content-type
+// flags. For content-type multipart/form-data, body is instead a
+// comma-separated list of field=value or field=@file specs, and the actual
+// content type (with the multipart boundary) is returned separately.
+func buildBody(body, bodyFile, contentType string) (io.ReadSeeker, string, error) {
+	if contentType == "multipart/form-data" {
+		return buildMultipartBody(body)
+	}
+
+	var data []byte
+	var err error
+
+	switch {
+	case bodyFile != "":
+		data, err = ioutil.ReadFile(bodyFile)
+		if err != nil {
+			return nil, "", fmt.Errorf("reading -body-file: %s", err)
+		}
+	case body != "":
+		data = []byte(body)
+	default:
+		return nil, contentType, nil
+	}
+
+	return bytes.NewReader(data), contentType, nil
+}
+
+func buildMultipartBody(spec string) (io.ReadSeeker, string, error) {
+	buf := &bytes.Buffer{}
+	w := multipart.NewWriter(buf)
+
+	for _, part := range strings.Split(spec, ",") {
+		field, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, "", fmt.Errorf("invalid multipart field %q, want 'field=value'", part)
+		}
+
+		if strings.HasPrefix(value, "@") {
+			path := value[1:]
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, "", fmt.Errorf("reading multipart file %s: %s", path, err)
+			}
+
+			fw, err := w.CreateFormFile(field, path)
+			if err != nil {
+				return nil, "", err
+			}
+			if _, err = fw.Write(data); err != nil {
+				return nil, "", err
+			}
+		} else if err := w.WriteField(field, value); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return bytes.NewReader(buf.Bytes()), w.FormDataContentType(), nil
+}
+
+func buildRequest(method, url string, body io.ReadSeeker, contentType string, headers []string) (*http.Request, error) {
+	var req *http.Request
+	var err error
+
+	if body != nil {
+		req, err = http.NewRequest(method, url, body)
+	} else {
+		req, err = http.NewRequest(method, url, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	if err = applyHeaders(req, headers); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// scenarioRequest is one weighted template in a -scenario file.
+type scenarioRequest struct {
+	Method      string   `yaml:"method"`
+	URL         string   `yaml:"url"`
+	Headers     []string `yaml:"headers"`
+	Body        string   `yaml:"body"`
+	BodyFile    string   `yaml:"body_file"`
+	ContentType string   `yaml:"content_type"`
+	Weight      int      `yaml:"weight"`
+}
+
+func loadScenario(path string) (*requestSet, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var templates []scenarioRequest
+	if err = yaml.Unmarshal(data, &templates); err != nil {
+		return nil, fmt.Errorf("parsing scenario: %s", err)
+	}
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("scenario %s defines no requests", path)
+	}
+
+	rs := &requestSet{}
+	var weighted bool
+	var cumulative int64
+
+	for _, t := range templates {
+		method := t.Method
+		if method == "" {
+			method = http.MethodGet
+		}
+
+		body, contentType, err := buildBody(t.Body, t.BodyFile, t.ContentType)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", t.URL, err)
+		}
+
+		req, err := buildRequest(method, t.URL, body, contentType, t.Headers)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", t.URL, err)
+		}
+
+		rs.reqs = append(rs.reqs, req)
+
+		weight := t.Weight
+		if weight <= 0 {
+			weight = 1
+		} else {
+			weighted = true
+		}
+		cumulative += int64(weight)
+		rs.weights = append(rs.weights, cumulative)
+	}
+
+	if !weighted {
+		rs.weights = nil
+	}
+
+	return rs, nil
 }
 
 func checkRequest(req *http.Request, client *http.Client) ([]string, error) {
 	redirects := make([]string, 0)
-	if client.CheckRedirect == nil {
-		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
-			redirects = append(redirects, req.URL.String())
-			if len(redirects) >= 10 {
-				return http.ErrUseLastResponse
-			}
-			return nil
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		redirects = append(redirects, req.URL.String())
+		if len(redirects) >= 10 {
+			return http.ErrUseLastResponse
 		}
+		return nil
 	}
 
 	resp, err := client.Do(req)
@@ -252,6 +933,302 @@ LOOP:
 	}
 }
 
+// outboundInterface returns the name of the local network interface that
+// would be used to reach u, determined by asking the kernel to route a
+// (never sent) UDP packet to it. Returns "" if it can't be determined, in
+// which case the tui falls back to NIC-less reporting.
+func outboundInterface(u *url.URL) string {
+	host := u.Hostname()
+	if host == "" {
+		return ""
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	conn, err := net.Dial("udp", net.JoinHostPort(host, port))
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+
+	local, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return ""
+	}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			var ip net.IP
+			switch a := addr.(type) {
+			case *net.IPNet:
+				ip = a.IP
+			case *net.IPAddr:
+				ip = a.IP
+			}
+			if ip != nil && ip.Equal(local.IP) {
+				return iface.Name
+			}
+		}
+	}
+
+	return ""
+}
+
+var sparkChars = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline renders vals as a single line of block characters scaled to the
+// largest value in the series.
+func sparkline(vals []float64) string {
+	max := 0.0
+	for _, v := range vals {
+		if v > max {
+			max = v
+		}
+	}
+	if max == 0 {
+		max = 1
+	}
+
+	b := make([]rune, len(vals))
+	for i, v := range vals {
+		idx := int(v / max * float64(len(sparkChars)-1))
+		if idx < 0 {
+			idx = 0
+		} else if idx >= len(sparkChars) {
+			idx = len(sparkChars) - 1
+		}
+		b[i] = sparkChars[idx]
+	}
+
+	return string(b)
+}
+
+// tuiWindowSecs is how much req/s and throughput history the dashboard keeps
+// for its sparklines.
+const tuiWindowSecs = 60
+
+// tuiLatencyTicks is how many livestats ticks (sent roughly every 500ms) are
+// merged into the windowed p50/p95/p99, i.e. about 10s of recent traffic.
+const tuiLatencyTicks = 20
+
+// runTUI replaces liveUpdates and errorReporter with a full-screen dashboard
+// when -live=tui is given: rolling req/s and throughput sparklines, windowed
+// latency percentiles, a status-code distribution bar, a live error tail, and
+// host CPU/load/NIC usage for the interface used to reach target.
+func runTUI(done <-chan struct{}, livech <-chan livestats, errors <-chan error,
+	duration time.Duration, target *url.URL, stopped chan<- struct{}) {
+
+	defer close(stopped)
+
+	iface := outboundInterface(target)
+
+	app := tview.NewApplication()
+	header := tview.NewTextView().SetDynamicColors(true)
+	rateView := tview.NewTextView().SetDynamicColors(true)
+	latView := tview.NewTextView().SetDynamicColors(true)
+	codeView := tview.NewTextView().SetDynamicColors(true)
+	sysView := tview.NewTextView().SetDynamicColors(true)
+	errView := tview.NewTextView().SetDynamicColors(true)
+	progress := tview.NewTextView().SetDynamicColors(true)
+
+	fmt.Fprintf(header, "[::b]gb[::-] load test of %s", target)
+
+	flex := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(header, 1, 0, false).
+		AddItem(rateView, 3, 0, false).
+		AddItem(latView, 2, 0, false).
+		AddItem(codeView, 2, 0, false).
+		AddItem(sysView, 2, 0, false).
+		AddItem(errView, 0, 1, false).
+		AddItem(progress, 1, 0, false)
+	app.SetRoot(flex, true)
+	app.SetFocus(flex)
+	app.SetInputCapture(func(ev *tcell.EventKey) *tcell.EventKey {
+		if ev.Key() == tcell.KeyCtrlC || ev.Rune() == 'q' {
+			app.Stop()
+			return nil
+		}
+		return ev
+	})
+
+	start := time.Now()
+	var reqRates, byteRates []float64
+	var reqSum, byteSum int64
+	codeTotals := make(map[int]int64)
+	var windows []*hdrHistogram
+	var errTail []string
+
+	addErr := func(err error) {
+		errTail = append(errTail, fmt.Sprintf("%s %s", time.Now().Format("15:04:05"), err))
+		if len(errTail) > 8 {
+			errTail = errTail[len(errTail)-8:]
+		}
+	}
+
+	var prevRx, prevTx uint64
+	if counters, err := gopsnet.IOCounters(true); err == nil {
+		for _, c := range counters {
+			if c.Name == iface {
+				prevRx, prevTx = c.BytesRecv, c.BytesSent
+			}
+		}
+	}
+
+	redraw := func(elapsed time.Duration, cpuPct float64, loadAvg string, rxRate, txRate uint64) {
+		rateView.Clear()
+		fmt.Fprintf(rateView, "req/s  %s\nbytes/s %s\n",
+			sparkline(reqRates), sparkline(byteRates))
+		if n := len(reqRates); n > 0 {
+			fmt.Fprintf(rateView, "last: %.0f req/s, %s/s\n", reqRates[n-1], reportSize(int64(byteRates[n-1])))
+		}
+
+		merged := newHDRHistogram(windowMaxUs(windows))
+		var n int64
+		for _, w := range windows {
+			merged.merge(w)
+		}
+		for _, c := range merged.counts {
+			n += c
+		}
+		sum := merged.summarize(n)
+		latView.Clear()
+		fmt.Fprintf(latView, "p50 %.1fms  p95 %.1fms  p99 %.1fms  (last %ds)\n",
+			sum.P50/1000, sum.P95/1000, sum.P99/1000, tuiLatencyTicks/2)
+
+		codeView.Clear()
+		fmt.Fprint(codeView, "codes  ")
+		var codes []int
+		for c := range codeTotals {
+			codes = append(codes, c)
+		}
+		sort.Ints(codes)
+		for _, c := range codes {
+			color := "green"
+			if c >= 400 {
+				color = "red"
+			} else if c >= 300 {
+				color = "yellow"
+			}
+			fmt.Fprintf(codeView, "[%s]%d:%d[-]  ", color, c, codeTotals[c])
+		}
+		fmt.Fprintln(codeView)
+
+		sysView.Clear()
+		fmt.Fprintf(sysView, "cpu %.0f%%  load %s  nic(%s) rx %s/s tx %s/s\n",
+			cpuPct, loadAvg, iface, reportSize(int64(rxRate)), reportSize(int64(txRate)))
+
+		percent := int(elapsed * 100 / duration)
+		if percent > 100 {
+			percent = 100
+		}
+		width := 40
+		filled := width * percent / 100
+		progress.Clear()
+		fmt.Fprintf(progress, "[%s%s] %3d%% (%s / %s)  [q] quit\n",
+			strings.Repeat("=", filled), strings.Repeat(" ", width-filled),
+			percent, elapsed.Round(time.Second), duration)
+
+		errView.Clear()
+		fmt.Fprint(errView, "[::b]errors[::-]\n")
+		for _, e := range errTail {
+			fmt.Fprintln(errView, e)
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+	LOOP:
+		for {
+			select {
+			case live, ok := <-livech:
+				if !ok {
+					continue
+				}
+				reqSum += live.req
+				byteSum += live.bytes
+				for code, n := range live.code {
+					codeTotals[code] += n
+				}
+				windows = append(windows, live.hist)
+				if len(windows) > tuiLatencyTicks {
+					windows = windows[len(windows)-tuiLatencyTicks:]
+				}
+			case err := <-errors:
+				addErr(err)
+			case t := <-ticker.C:
+				reqRates = append(reqRates, float64(reqSum))
+				byteRates = append(byteRates, float64(byteSum))
+				if len(reqRates) > tuiWindowSecs {
+					reqRates = reqRates[len(reqRates)-tuiWindowSecs:]
+					byteRates = byteRates[len(byteRates)-tuiWindowSecs:]
+				}
+				reqSum, byteSum = 0, 0
+
+				cpuPcts, _ := cpu.Percent(0, false)
+				var cpuPct float64
+				if len(cpuPcts) > 0 {
+					cpuPct = cpuPcts[0]
+				}
+				loadAvg := "n/a"
+				if l, err := load.Avg(); err == nil {
+					loadAvg = fmt.Sprintf("%.2f %.2f %.2f", l.Load1, l.Load5, l.Load15)
+				}
+
+				var rxRate, txRate uint64
+				if counters, err := gopsnet.IOCounters(true); err == nil {
+					for _, c := range counters {
+						if c.Name == iface {
+							rxRate, txRate = c.BytesRecv-prevRx, c.BytesSent-prevTx
+							prevRx, prevTx = c.BytesRecv, c.BytesSent
+						}
+					}
+				}
+
+				elapsed := t.Sub(start)
+				app.QueueUpdateDraw(func() {
+					redraw(elapsed, cpuPct, loadAvg, rxRate, txRate)
+				})
+			case <-done:
+				break LOOP
+			}
+		}
+		app.Stop()
+	}()
+
+	_ = app.Run()
+
+	// workers might still be sending livestats/errors
+	for range livech {
+	}
+	for range errors {
+	}
+}
+
+// windowMaxUs returns the maxUs of the histograms being merged in a tui
+// latency window, defaulting to the first window's size (they're all built
+// with the same -timeout, so any one of them will do).
+func windowMaxUs(windows []*hdrHistogram) int64 {
+	if len(windows) == 0 {
+		return hdrSubBuckets
+	}
+	return windows[0].maxUs
+}
+
 func rampupGenerator(rampch chan<- struct{}, done <-chan struct{}, n int, total time.Duration) {
 	if total == 0 {
 		close(rampch)
@@ -313,8 +1290,48 @@ func rateTicker(rate int, done <-chan struct{}) <-chan struct{} {
 	return tickch
 }
 
-func collectStats(result <-chan *stats, n int) *stats {
-	total := newStats()
+// poissonScheduler drives -model open: request start times are scheduled
+// from a Poisson process at rate λ (interarrival = rand.ExpFloat64()/λ)
+// instead of being handed out whenever a worker happens to be free, so a
+// stalled server shows up as queueing delay in the histogram rather than
+// being silently absorbed by the closed loop (coordinated omission). missed
+// is incremented, without blocking the generator, whenever the bounded
+// channel is still full when the next slot is due.
+func poissonScheduler(rate int, bufSize int, done <-chan struct{}, missed *int64) <-chan time.Time {
+	schedch := make(chan time.Time, bufSize)
+	lambda := float64(rate)
+
+	go func() {
+		defer close(schedch)
+
+		for {
+			wait := time.Duration(rand.ExpFloat64() / lambda * float64(time.Second))
+
+			select {
+			case <-time.After(wait):
+			case <-done:
+				return
+			}
+
+			select {
+			case schedch <- time.Now():
+			default:
+				atomic.AddInt64(missed, 1)
+			}
+
+			select {
+			case <-done:
+				return
+			default:
+			}
+		}
+	}()
+
+	return schedch
+}
+
+func collectStats(result <-chan *stats, n int, maxUs int64) *stats {
+	total := newStats(maxUs)
 
 	for i := 0; i < n; i++ {
 		s := <-result
@@ -325,9 +1342,13 @@ func collectStats(result <-chan *stats, n int) *stats {
 		for k, v := range s.code {
 			total.code[k] += v
 		}
-		for k, v := range s.hist {
-			total.hist[k] += v
+		for k, v := range s.proto {
+			total.proto[k] += v
 		}
+		total.reused += s.reused
+		total.newconn += s.newconn
+		total.retries += s.retries
+		total.hist.merge(s.hist)
 	}
 
 	return total
@@ -398,57 +1419,83 @@ func reportStatus(total *stats) {
 	for _, c := range codes {
 		fmt.Printf("Status[%d]: %d\n", c, total.code[c])
 	}
+
+	if len(total.proto) > 0 {
+		fmt.Println()
+
+		protos := make([]string, 0, len(total.proto))
+		for p := range total.proto {
+			protos = append(protos, p)
+		}
+		sort.Strings(protos)
+
+		for _, p := range protos {
+			fmt.Printf("Protocol[%s]: %d\n", p, total.proto[p])
+		}
+
+		fmt.Printf("Connections reused: %d, new: %d\n", total.reused, total.newconn)
+	}
 }
 
 func reportHistogram(total *stats) {
-	if len(total.hist) == 0 {
+	if total.req == 0 {
 		return
 	}
 
 	fmt.Println()
 
-	milis := make([]int, 0, len(total.hist))
+	sum := total.hist.summarize(total.req)
+	fmt.Printf("Min: %.3f ms\n", sum.Min)
+	fmt.Printf("Mean: %.3f ms\n", sum.Mean)
+	fmt.Printf("StdDev: %.3f ms\n", sum.StdDev)
+	fmt.Printf("p50: %.3f ms  p75: %.3f ms  p90: %.3f ms  p95: %.3f ms\n", sum.P50, sum.P75, sum.P90, sum.P95)
+	fmt.Printf("p99: %.3f ms  p99.9: %.3f ms  p99.99: %.3f ms  Max: %.3f ms\n", sum.P99, sum.P999, sum.P9999, sum.Max)
+
+	fmt.Println()
+	reportHistogramBars(total)
+}
+
+// reportHistogramBars prints the ASCII bar chart, collapsing adjacent
+// sub-buckets: each row aggregates a whole power-of-two bucket instead of
+// every individual ~0.78%-wide sub-bucket, keeping the chart readable.
+func reportHistogramBars(total *stats) {
+	numBuckets := len(total.hist.counts) / hdrSubBuckets
+
+	rowCounts := make([]int64, numBuckets)
+	rowMax := make([]int64, numBuckets)
 	var cmax int64
-	for t, c := range total.hist {
-		milis = append(milis, t)
-		if c > cmax {
-			cmax = c
+
+	for idx, c := range total.hist.counts {
+		if c == 0 {
+			continue
+		}
+
+		b := idx / hdrSubBuckets
+		rowCounts[b] += c
+		rowMax[b] = total.hist.valueAt(idx)
+		if rowCounts[b] > cmax {
+			cmax = rowCounts[b]
 		}
 	}
-	sort.Ints(milis)
 
-	mwidth := len(fmt.Sprintf("%d", milis[len(milis)-1]))
-	cwidth := len(fmt.Sprintf("%d", cmax))
+	if cmax == 0 {
+		return
+	}
 
-	var sum, percentile int64
-	want := []int64{10, 25, 50, 75, 90, 95, 99}
-	next := 0
+	mwidth := len(fmt.Sprintf("%d", rowMax[numBuckets-1]))
+	cwidth := len(fmt.Sprintf("%d", cmax))
 	gwidth := 60 - mwidth - cwidth
 
-	for _, m := range milis {
-		s1 := fmt.Sprintf("Time[%*d ms]: %*d", mwidth, m, cwidth, total.hist[m])
-		s2 := "     "
-
-		if next < len(want) {
-			sum += total.hist[m]
-			percentile = sum * 100 / total.req
-
-			i := next
-			for i < len(want) && percentile >= want[i] {
-				i++
-			}
-			i--
-
-			if i >= next {
-				s2 = fmt.Sprintf("(%d%%)", want[i])
-				next = i + 1
-			}
+	for b := 0; b < numBuckets; b++ {
+		if rowCounts[b] == 0 {
+			continue
 		}
 
-		stars := total.hist[m] * int64(gwidth) / cmax
-		s3 := "|" + strings.Repeat("*", int(stars))
+		s1 := fmt.Sprintf("Time[%*d us]: %*d", mwidth, rowMax[b], cwidth, rowCounts[b])
+		stars := rowCounts[b] * int64(gwidth) / cmax
+		s2 := "|" + strings.Repeat("*", int(stars))
 
-		fmt.Println(s1, s2, s3)
+		fmt.Println(s1, s2)
 	}
 }
 
@@ -467,6 +1514,9 @@ func reportStats(total *stats, duration time.Duration, histogram bool) {
 	if total.rerr > 0 {
 		fmt.Println("Read errors:", total.rerr)
 	}
+	if total.retries > 0 {
+		fmt.Println("Retries:", total.retries)
+	}
 
 	reportStatus(total)
 
@@ -475,6 +1525,167 @@ func reportStats(total *stats, duration time.Duration, histogram bool) {
 	}
 }
 
+// runReport is the -output JSON snapshot of a completed benchmark run, also
+// used as the -compare baseline.
+type runReport struct {
+	Config      runConfig     `json:"config"`
+	Duration    float64       `json:"duration_seconds"`
+	Requests    int64         `json:"requests"`
+	Rate        float64       `json:"rate_req_per_sec"`
+	Bytes       int64         `json:"bytes"`
+	Throughput  float64       `json:"throughput_bytes_per_sec"`
+	Bandwidth   float64       `json:"bandwidth_bits_per_sec"`
+	ConnErrors  int64         `json:"connection_errors"`
+	ReadErrors  int64         `json:"read_errors"`
+	Retries     int64         `json:"retries"`
+	StatusCodes map[int]int64 `json:"status_codes"`
+	Histogram   histogramData `json:"histogram"`
+	MinMs       float64       `json:"min_ms"`
+	MeanMs      float64       `json:"mean_ms"`
+	StdDevMs    float64       `json:"stddev_ms"`
+	P50Ms       float64       `json:"p50_ms"`
+	P75Ms       float64       `json:"p75_ms"`
+	P90Ms       float64       `json:"p90_ms"`
+	P95Ms       float64       `json:"p95_ms"`
+	P99Ms       float64       `json:"p99_ms"`
+	P999Ms      float64       `json:"p99_9_ms"`
+	P9999Ms     float64       `json:"p99_99_ms"`
+	MaxMs       float64       `json:"max_ms"`
+	Host        hostInfo      `json:"host"`
+}
+
+// histogramData is the raw HDR bucket counts, for -hdr-file-style offline
+// analysis from a -output JSON file.
+type histogramData struct {
+	SubBuckets int     `json:"sub_buckets"`
+	MaxMicros  int64   `json:"max_micros"`
+	Counts     []int64 `json:"counts"`
+}
+
+type runConfig struct {
+	URL      string `json:"url,omitempty"`
+	Method   string `json:"method,omitempty"`
+	Scenario string `json:"scenario,omitempty"`
+	Parallel int    `json:"parallel"`
+	Rate     int    `json:"rate"`
+	Timeout  string `json:"timeout"`
+}
+
+type hostInfo struct {
+	Hostname string `json:"hostname"`
+	OS       string `json:"os"`
+	Arch     string `json:"arch"`
+	NumCPU   int    `json:"num_cpu"`
+}
+
+func buildReport(f *flags, url string, total *stats, duration time.Duration) *runReport {
+	sum := total.hist.summarize(total.req)
+	hostname, _ := os.Hostname()
+
+	config := runConfig{
+		URL:      url,
+		Method:   f.method,
+		Parallel: f.parallel,
+		Rate:     f.rate,
+		Timeout:  f.timeout.String(),
+	}
+	if f.scenario != "" {
+		config.URL = ""
+		config.Method = ""
+		config.Scenario = f.scenario
+	}
+
+	return &runReport{
+		Config:      config,
+		Duration:    duration.Seconds(),
+		Requests:    total.req,
+		Rate:        float64(total.req) / duration.Seconds(),
+		Bytes:       total.bytes,
+		Throughput:  float64(total.bytes) / duration.Seconds(),
+		Bandwidth:   float64(8*total.bytes) / duration.Seconds(),
+		ConnErrors:  total.err,
+		ReadErrors:  total.rerr,
+		Retries:     total.retries,
+		StatusCodes: total.code,
+		Histogram: histogramData{
+			SubBuckets: hdrSubBuckets,
+			MaxMicros:  total.hist.maxUs,
+			Counts:     total.hist.counts,
+		},
+		MinMs:    sum.Min,
+		MeanMs:   sum.Mean,
+		StdDevMs: sum.StdDev,
+		P50Ms:    sum.P50,
+		P75Ms:    sum.P75,
+		P90Ms:    sum.P90,
+		P95Ms:    sum.P95,
+		P99Ms:    sum.P99,
+		P999Ms:   sum.P999,
+		P9999Ms:  sum.P9999,
+		MaxMs:    sum.Max,
+		Host: hostInfo{
+			Hostname: hostname,
+			OS:       runtime.GOOS,
+			Arch:     runtime.GOARCH,
+			NumCPU:   runtime.NumCPU(),
+		},
+	}
+}
+
+func writeReport(path string, r *runReport) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func loadReport(path string) (*runReport, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var r runReport
+	if err = json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("parsing %s: %s", path, err)
+	}
+
+	return &r, nil
+}
+
+// compareReports prints a side-by-side diff of baseline vs current and
+// reports whether the run regressed past threshold percent on rate or p95
+// latency.
+func compareReports(base, current *runReport, threshold float64) bool {
+	fmt.Println()
+	fmt.Println("Comparison (baseline -> current):")
+
+	rateDelta := percentDelta(base.Rate, current.Rate)
+	printComparison("Rate (req/s)", base.Rate, current.Rate, rateDelta)
+	printComparison("Mean latency (ms)", base.MeanMs, current.MeanMs, percentDelta(base.MeanMs, current.MeanMs))
+	printComparison("p50 latency (ms)", base.P50Ms, current.P50Ms, percentDelta(base.P50Ms, current.P50Ms))
+	p95Delta := percentDelta(base.P95Ms, current.P95Ms)
+	printComparison("p95 latency (ms)", base.P95Ms, current.P95Ms, p95Delta)
+	printComparison("p99 latency (ms)", base.P99Ms, current.P99Ms, percentDelta(base.P99Ms, current.P99Ms))
+	printComparison("Throughput (B/s)", base.Throughput, current.Throughput, percentDelta(base.Throughput, current.Throughput))
+
+	return rateDelta <= -threshold || p95Delta >= threshold
+}
+
+func percentDelta(base, current float64) float64 {
+	if base == 0 {
+		return 0
+	}
+
+	return (current - base) / base * 100
+}
+
+func printComparison(name string, base, current, delta float64) {
+	fmt.Printf("  %-20s %10.2f -> %10.2f (%+.1f%%)\n", name, base, current, delta)
+}
+
 func updateRlimit(parallel int) error {
 	var val syscall.Rlimit
 
@@ -535,19 +1746,53 @@ func writeMemProfile(filename string) {
 	}
 }
 
+// headerList collects repeated -header flags into a slice.
+type headerList []string
+
+func (h *headerList) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerList) Set(v string) error {
+	*h = append(*h, v)
+	return nil
+}
+
 type flags struct {
-	compression bool
-	cpuprofile  string
-	duration    time.Duration
-	gcpercent   int
-	histogram   bool
-	live        bool
-	memprofile  string
-	parallel    int
-	rampup      time.Duration
-	rate        int
-	redirects   bool
-	timeout     time.Duration
+	body                string
+	bodyFile            string
+	compare             string
+	compression         bool
+	connections         int
+	contentType         string
+	cpuprofile          string
+	duration            time.Duration
+	gcpercent           int
+	h2MaxStreams        int
+	h2PingTimeout       time.Duration
+	h2ReadIdleTimeout   time.Duration
+	hdrFile             string
+	headers             headerList
+	histogram           bool
+	injectDelay         string
+	injectDisconnectP   float64
+	injectFailCodes     string
+	injectFailRate      float64
+	live                string
+	memprofile          string
+	method              string
+	model               string
+	output              string
+	parallel            int
+	proto               string
+	rampup              time.Duration
+	rate                int
+	redirects           bool
+	regressionThreshold float64
+	retry               int
+	retryBackoff        time.Duration
+	scenario            string
+	timeout             time.Duration
 }
 
 func printUsage() {
@@ -559,17 +1804,57 @@ func printUsage() {
 func parseFlags() *flags {
 	f := flags{}
 
+	flag.StringVar(&f.body, "body", "", "request body; for -content-type multipart/form-data "+
+		"a comma-separated list of field=value or field=@file specs")
+	flag.StringVar(&f.bodyFile, "body-file", "", "read request body from file")
+	flag.StringVar(&f.compare, "compare", "", "compare this run against a -output baseline "+
+		"json file and report rate/latency/throughput deltas")
 	flag.BoolVar(&f.compression, "compression", true, "use HTTP compression")
+	flag.IntVar(&f.connections, "connections", 1, "with -proto h2/h2c/h3, number of underlying "+
+		"transports (connections) the -parallel streams are spread over")
+	flag.StringVar(&f.contentType, "content-type", "", "request Content-Type, e.g. application/json, "+
+		"application/x-www-form-urlencoded or multipart/form-data")
 	flag.StringVar(&f.cpuprofile, "cpuprofile", "", "write cpu profile to file")
 	flag.DurationVar(&f.duration, "duration", 15*time.Second, "test duration")
 	flag.IntVar(&f.gcpercent, "gcpercent", 1000, "garbage collection target percentage")
+	flag.IntVar(&f.h2MaxStreams, "h2-max-streams", 0, "with -proto h2/h2c/h3, cap concurrent "+
+		"streams per connection (0 = unlimited)")
+	flag.DurationVar(&f.h2PingTimeout, "h2-ping-timeout", 15*time.Second,
+		"with -proto h2/h2c/h3, timeout waiting for a health-check ping response")
+	flag.DurationVar(&f.h2ReadIdleTimeout, "h2-read-idle-timeout", 30*time.Second,
+		"with -proto h2/h2c/h3, send a health-check ping after this much idle time")
+	flag.StringVar(&f.hdrFile, "hdr-file", "", "dump raw histogram bucket counts to file for offline analysis")
+	flag.Var(&f.headers, "header", "custom header 'Key: Value' (repeatable)")
 	flag.BoolVar(&f.histogram, "histogram", false, "display response time histogram")
-	flag.BoolVar(&f.live, "live", false, "show periodic progress updates")
+	flag.StringVar(&f.injectDelay, "inject-delay", "", "randomly delay requests before dispatch, "+
+		"'p=0.05,ms=2000' sleeps 2s on 5% of requests")
+	flag.Float64Var(&f.injectDisconnectP, "inject-disconnect", 0,
+		"probability (0-1) of simulating a dropped connection instead of dispatching a request")
+	flag.StringVar(&f.injectFailCodes, "inject-fail-codes", "", "comma-separated status codes to "+
+		"synthesize for -inject-fail-rate, e.g. 500,502,503")
+	flag.Float64Var(&f.injectFailRate, "inject-fail-rate", 0,
+		"probability (0-1) of synthesizing an -inject-fail-codes response instead of dispatching a request")
+	flag.StringVar(&f.live, "live", "", "show live progress: text (periodic printf updates) or "+
+		"tui (full-screen dashboard with sparklines, windowed percentiles and host load)")
 	flag.StringVar(&f.memprofile, "memprofile", "", "write memory profile to file")
-	flag.IntVar(&f.parallel, "parallel", 20, "number of parallel client connections")
+	flag.StringVar(&f.method, "method", http.MethodGet, "HTTP request method")
+	flag.StringVar(&f.model, "model", "closed", "load model: closed (workers send requests back to back) "+
+		"or open (Poisson-scheduled arrivals at -rate, corrected for coordinated omission)")
+	flag.StringVar(&f.output, "output", "", "write run results as json to file, for archiving or -compare")
+	flag.IntVar(&f.parallel, "parallel", 20, "number of parallel client connections "+
+		"(with -proto h2/h2c/h3, concurrent streams instead)")
+	flag.StringVar(&f.proto, "proto", "auto", "transport protocol: h1, h2, h2c, h3 or auto (negotiate via ALPN)")
 	flag.DurationVar(&f.rampup, "rampup", 0, "startup interval for client connections")
 	flag.IntVar(&f.rate, "rate", 0, "limit rate (requests per second)")
 	flag.BoolVar(&f.redirects, "redirects", true, "follow HTTP redirects")
+	flag.Float64Var(&f.regressionThreshold, "regression-threshold", 10,
+		"with -compare, percent rate drop or p95 latency increase that fails the run")
+	flag.IntVar(&f.retry, "retry", 0, "retry idempotent requests this many times on connection "+
+		"error, with exponential backoff and jitter")
+	flag.DurationVar(&f.retryBackoff, "retry-backoff", 100*time.Millisecond,
+		"with -retry, base delay before the first retry (doubles each attempt)")
+	flag.StringVar(&f.scenario, "scenario", "", "yaml file with a list of weighted request "+
+		"templates; workers pick the next one round-robin or by weight instead of benchmarking a single url")
 	flag.DurationVar(&f.timeout, "timeout", 10*time.Second, "request timeout")
 
 	flag.Usage = printUsage
@@ -582,12 +1867,36 @@ func main() {
 	f := parseFlags()
 
 	url := flag.Arg(0)
-	if url == "" {
+	if url == "" && f.scenario == "" {
 		fmt.Printf("Error: No url given\n\n")
 		printUsage()
 		os.Exit(1)
 	}
 
+	if f.model != "closed" && f.model != "open" {
+		fmt.Printf("Error: Invalid -model %s, must be closed or open\n", f.model)
+		os.Exit(1)
+	}
+	if f.model == "open" && f.rate <= 0 {
+		fmt.Printf("Error: -model open requires -rate > 0\n")
+		os.Exit(1)
+	}
+
+	if f.live != "" && f.live != "text" && f.live != "tui" {
+		fmt.Printf("Error: Invalid -live %s, must be text or tui\n", f.live)
+		os.Exit(1)
+	}
+
+	for name, p := range map[string]float64{
+		"-inject-fail-rate":  f.injectFailRate,
+		"-inject-disconnect": f.injectDisconnectP,
+	} {
+		if p < 0 || p > 1 {
+			fmt.Printf("Error: Invalid %s %v, must be between 0 and 1\n", name, p)
+			os.Exit(1)
+		}
+	}
+
 	if startCPUProfile(f.cpuprofile) {
 		defer stopCPUProfile()
 	}
@@ -599,7 +1908,7 @@ func main() {
 	errors := make(chan error)
 
 	var livech chan livestats
-	if f.live {
+	if f.live != "" {
 		size := f.parallel
 		if size > 1000 {
 			size = 1000
@@ -608,37 +1917,110 @@ func main() {
 	}
 
 	rampch := make(chan struct{})
-	tickch := rateTicker(f.rate, done)
 
-	req, err := buildRequest(http.MethodGet, url)
-	if err != nil {
-		fmt.Printf("Invalid url %s: %s\n", url, err)
-		os.Exit(1)
+	var tickch <-chan struct{}
+	var schedch <-chan time.Time
+	var missed int64
+	if f.model == "open" {
+		schedch = poissonScheduler(f.rate, f.parallel, done, &missed)
+	} else {
+		tickch = rateTicker(f.rate, done)
+	}
+
+	var reqs *requestSet
+	var err error
+	if f.scenario != "" {
+		reqs, err = loadScenario(f.scenario)
+		if err != nil {
+			fmt.Printf("Invalid scenario %s: %s\n", f.scenario, err)
+			os.Exit(1)
+		}
+	} else {
+		body, contentType, err := buildBody(f.body, f.bodyFile, f.contentType)
+		if err != nil {
+			fmt.Printf("Invalid request body: %s\n", err)
+			os.Exit(1)
+		}
+
+		req, err := buildRequest(f.method, url, body, contentType, f.headers)
+		if err != nil {
+			fmt.Printf("Invalid url %s: %s\n", url, err)
+			os.Exit(1)
+		}
+
+		reqs = newRequestSet(req)
 	}
 
-	redirs, err := checkRequest(req, buildClient(f.compression, f.redirects, f.timeout))
+	h2opts := h2Options{
+		maxConcurrentStreams: f.h2MaxStreams,
+		readIdleTimeout:      f.h2ReadIdleTimeout,
+		pingTimeout:          f.h2PingTimeout,
+	}
+
+	checkClient, err := buildClient(f.proto, f.compression, f.redirects, f.timeout, h2opts)
 	if err != nil {
-		fmt.Printf("Url check failed for %s: %s\n", url, err)
+		fmt.Printf("Invalid -proto %s: %s\n", f.proto, err)
 		os.Exit(1)
 	}
-	if len(redirs) > 0 {
-		fmt.Printf("Warning: redirects detected: %s -> %s\n", url, strings.Join(redirs, " -> "))
+
+	for _, req := range reqs.reqs {
+		redirs, err := checkRequest(req, checkClient)
+		if err != nil {
+			fmt.Printf("Url check failed for %s: %s\n", req.URL, err)
+			os.Exit(1)
+		}
+		if len(redirs) > 0 {
+			fmt.Printf("Warning: redirects detected: %s -> %s\n", req.URL, strings.Join(redirs, " -> "))
+		}
 	}
 
 	if err = updateRlimit(f.parallel); err != nil {
 		fmt.Println("Warning: failed to update rlimit:", err)
 	}
 
-	fmt.Printf("Running %d parallel clients for %v...\n", f.parallel, f.duration)
+	injectCodes, err := parseInjectCodes(f.injectFailCodes)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	injectDelayP, injectDelay, err := parseInjectDelay(f.injectDelay)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	inject := injectOptions{
+		failRate:       f.injectFailRate,
+		failCodes:      injectCodes,
+		delayProb:      injectDelayP,
+		delay:          injectDelay,
+		disconnectProb: f.injectDisconnectP,
+	}
+
+	clients, err := buildClientPool(f, h2opts, inject)
+	if err != nil {
+		fmt.Printf("Invalid -proto %s: %s\n", f.proto, err)
+		os.Exit(1)
+	}
+
+	if f.live != "tui" {
+		fmt.Printf("Running %d parallel clients for %v...\n", f.parallel, f.duration)
+	}
 	for i := 0; i < f.parallel; i++ {
-		cli := buildClient(f.compression, f.redirects, f.timeout)
-		go bench(i+1, req, cli, done, result, errors, rampch, livech, tickch)
+		cli := clients[i%len(clients)]
+		go bench(i+1, reqs, cli, f.timeout, done, result, errors, rampch, livech, tickch, schedch,
+			f.retry, f.retryBackoff)
 	}
 
-	if f.live {
+	tuiStopped := make(chan struct{})
+	switch f.live {
+	case "tui":
+		go runTUI(done, livech, errors, f.duration, reqs.reqs[0].URL, tuiStopped)
+	case "text":
 		go liveUpdates(done, livech, f.duration)
+		go errorReporter(done, errors)
+	default:
+		go errorReporter(done, errors)
 	}
-	go errorReporter(done, errors)
 	go rampupGenerator(rampch, done, f.parallel, f.rampup)
 
 	t1 := time.Now()
@@ -652,17 +2034,58 @@ func main() {
 	case <-intr:
 	}
 
-	fmt.Println("Stopping clients and collecting results...")
+	if f.live != "tui" {
+		fmt.Println("Stopping clients and collecting results...")
+	}
 	close(done)
 
 	delta := time.Since(t1)
-	total := collectStats(result, f.parallel)
+	total := collectStats(result, f.parallel, f.timeout.Microseconds())
 	reportStats(total, delta, f.histogram)
 
+	if f.model == "open" {
+		fmt.Println("Missed deadlines (scheduler queue full):", atomic.LoadInt64(&missed))
+	}
+
+	if f.hdrFile != "" {
+		if err := writeHDRFile(f.hdrFile, total.hist); err != nil {
+			fmt.Println("Warning: failed to write -hdr-file:", err)
+		}
+	}
+
+	regressed := false
+	if f.output != "" || f.compare != "" {
+		report := buildReport(f, url, total, delta)
+
+		if f.output != "" {
+			if err = writeReport(f.output, report); err != nil {
+				fmt.Println("Warning: failed to write -output:", err)
+			}
+		}
+
+		if f.compare != "" {
+			baseline, err := loadReport(f.compare)
+			if err != nil {
+				fmt.Println("Warning: failed to load -compare baseline:", err)
+			} else {
+				regressed = compareReports(baseline, report, f.regressionThreshold)
+			}
+		}
+	}
+
 	close(errors)
 	if livech != nil {
 		close(livech)
 	}
+	if f.live == "tui" {
+		<-tuiStopped
+	}
 
 	writeMemProfile(f.memprofile)
+
+	if regressed {
+		fmt.Println()
+		fmt.Println("Regression threshold exceeded")
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+// TestHDRHistogramRoundTrip guards against the linear/log region overlap bug
+// where e.g. 150us and 200us collided with real 22us/72us samples: valueAt
+// should recover close to the original value for any v, and exactly for v
+// in the linear region.
+func TestHDRHistogramRoundTrip(t *testing.T) {
+	h := newHDRHistogram(10_000_000)
+
+	linear := []int64{1, 50, 127, 128, 150, 200, 255}
+	for _, v := range linear {
+		idx := h.index(v)
+		if got := h.valueAt(idx); got != v {
+			t.Errorf("linear value %d: index=%d, valueAt=%d, want exact %d", v, idx, got, v)
+		}
+	}
+
+	logValues := []int64{256, 300, 383, 384, 511, 512, 1000, 5000, 50000, 100000, 1000000, 9999999}
+	for _, v := range logValues {
+		idx := h.index(v)
+		got := h.valueAt(idx)
+
+		diff := got - v
+		if diff < 0 {
+			diff = -diff
+		}
+		if tolerance := v/100 + 2; diff > tolerance {
+			t.Errorf("log value %d: index=%d, valueAt=%d, want within %d of %d", v, idx, got, tolerance, v)
+		}
+	}
+}
+
+// TestHDRHistogramNoRegionOverlap guards against the linear region (bucket 0)
+// sharing slots with the log region, which previously made e.g. 150us and
+// 200us alias onto 22us and 72us.
+func TestHDRHistogramNoRegionOverlap(t *testing.T) {
+	h := newHDRHistogram(1_000_000)
+
+	for v := int64(1); v < 2*hdrSubBuckets; v++ {
+		if idx := h.index(v); idx != int(v) {
+			t.Fatalf("linear value %d mapped to slot %d, want %d", v, idx, v)
+		}
+	}
+
+	for v := int64(2 * hdrSubBuckets); v < 1_000_000; v += 37 {
+		if idx := h.index(v); idx < 2*hdrSubBuckets {
+			t.Fatalf("log-region value %d mapped to linear slot %d", v, idx)
+		}
+	}
+}